@@ -0,0 +1,48 @@
+// Command smbcsi runs smbdriver's mount implementation as a Kubernetes CSI
+// node plugin, listening for NodeStageVolume/NodePublishVolume calls on a
+// Unix domain socket instead of being invoked through Cloud Foundry's
+// dockerdriver bridge.
+package main
+
+import (
+	"flag"
+	"os"
+
+	"code.cloudfoundry.org/goshims/ioutilshim"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/smbdriver"
+	"code.cloudfoundry.org/smbdriver/csi"
+	"code.cloudfoundry.org/smbdriver/mount"
+)
+
+func main() {
+	endpoint := flag.String("endpoint", "/csi/csi.sock", "CSI endpoint Unix socket")
+	nodeID := flag.String("node-id", "", "node ID to report in NodeGetInfo")
+	volumesRoot := flag.String("volumes-root", "/var/lib/kubelet", "trusted root directory every mount target is expected to live under")
+	credentialsScratchDir := flag.String("credentials-scratch-dir", "/var/vcap/data/smbcsi/credentials", "tmpfs-backed scratch directory credentials files are briefly written to")
+	flag.Parse()
+
+	logger, _ := lager.NewFromSink("smbcsi", lager.NewPrettySink(os.Stdout, lager.DEBUG))
+
+	config := smbdriver.NewSmbConfig()
+	if err := config.ReadConf("source,username,password,vers,mountPermissions,domain", "", []string{"source"}); err != nil {
+		logger.Fatal("read-conf-failed", err)
+	}
+	config.SetUseCredentialsFile(true)
+
+	mountUtil := mount.New()
+	if err := os.MkdirAll(*credentialsScratchDir, 0700); err != nil {
+		logger.Fatal("credentials-scratch-dir-mkdir-failed", err)
+	}
+	if err := mountUtil.Mount("tmpfs", *credentialsScratchDir, "tmpfs", nil); err != nil {
+		logger.Fatal("credentials-scratch-dir-mount-failed", err)
+	}
+
+	mounter := smbdriver.NewSmbMounter(&osshim.OsShim{}, &ioutilshim.IoutilShim{}, config, mountUtil, *volumesRoot, "/var/vcap/data/smbcsi", *credentialsScratchDir)
+
+	driver := csi.NewDriver(logger, mounter, config, *nodeID)
+	if err := driver.Run(*endpoint); err != nil {
+		logger.Fatal("run-failed", err)
+	}
+}
@@ -0,0 +1,13 @@
+package csi_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestCsi(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Csi Suite")
+}
@@ -0,0 +1,71 @@
+// Package csi wraps the existing smbdriver volumedriver.Mounter behind a CSI
+// (Container Storage Interface) node/identity gRPC service, so the same
+// mount implementation can be deployed as a Kubernetes CSI driver in
+// addition to being reached through Cloud Foundry's dockerdriver bridge or
+// the standalone dockerplugin HTTP API.
+package csi
+
+import (
+	"net"
+	"os"
+
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/smbdriver"
+	"code.cloudfoundry.org/volumedriver"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+)
+
+const (
+	driverName    = "smb.csi.smbdriver.cloudfoundry.org"
+	driverVersion = "0.1.0"
+)
+
+// Driver bundles the CSI identity and node services backed by a single
+// volumedriver.Mounter.
+type Driver struct {
+	logger lager.Logger
+	server *grpc.Server
+}
+
+// NewDriver builds a Driver that delegates mount operations to mounter,
+// validating volume context against config the same way the dockerdriver
+// and dockerplugin entrypoints do.
+func NewDriver(logger lager.Logger, mounter volumedriver.Mounter, config *smbdriver.Config, nodeID string) *Driver {
+	logger = logger.Session("smbcsi")
+
+	server := grpc.NewServer()
+	csi.RegisterIdentityServer(server, &identityServer{})
+	csi.RegisterNodeServer(server, &nodeServer{
+		logger:  logger,
+		mounter: mounter,
+		config:  config,
+		nodeID:  nodeID,
+	})
+
+	return &Driver{logger: logger, server: server}
+}
+
+// Run listens on the CSI Unix domain socket at endpoint (e.g.
+// /csi/csi.sock) and serves until the listener is closed. It returns nil
+// once Stop has been called, even if Stop ran before serving began.
+func (d *Driver) Run(endpoint string) error {
+	_ = os.Remove(endpoint)
+
+	listener, err := net.Listen("unix", endpoint)
+	if err != nil {
+		return err
+	}
+
+	d.logger.Info("listening", lager.Data{"endpoint": endpoint})
+	err = d.server.Serve(listener)
+	if err == grpc.ErrServerStopped {
+		return nil
+	}
+	return err
+}
+
+// Stop gracefully stops the gRPC server.
+func (d *Driver) Stop() {
+	d.server.GracefulStop()
+}
@@ -0,0 +1,148 @@
+package csi
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/smbdriver"
+	"code.cloudfoundry.org/volumedriver"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// bindMounter is implemented by mounters that can perform a plain bind mount
+// without going through Mount's cifs option validation. NodePublishVolume
+// uses this to project an already-staged cifs mount into a pod's target
+// path; the volumedriver.Mounter interface has no room for a "this isn't
+// really a cifs mount" option, so this is a narrower interface the concrete
+// smbMounter also satisfies.
+type bindMounter interface {
+	BindMount(env dockerdriver.Env, source, target string) error
+}
+
+// volumeContextKeys maps the CSI VolumeContext keys a StorageClass/PV may
+// set onto the option names the existing smbdriver.Config allowed/mandatory
+// machinery already knows about.
+var volumeContextKeys = []string{"source", "username", "password", "vers", "mountPermissions", "domain"}
+
+// nodeServer implements the CSI Node service by delegating to the same
+// volumedriver.Mounter used by the dockerdriver and dockerplugin entrypoints.
+type nodeServer struct {
+	csi.UnimplementedNodeServer
+
+	logger  lager.Logger
+	mounter volumedriver.Mounter
+	config  *smbdriver.Config
+	nodeID  string
+}
+
+func (n *nodeServer) NodeGetInfo(ctx context.Context, req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
+	return &csi.NodeGetInfoResponse{NodeId: n.nodeID}, nil
+}
+
+func (n *nodeServer) NodeGetCapabilities(ctx context.Context, req *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
+	capability := func(t csi.NodeServiceCapability_RPC_Type) *csi.NodeServiceCapability {
+		return &csi.NodeServiceCapability{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{Type: t},
+			},
+		}
+	}
+
+	return &csi.NodeGetCapabilitiesResponse{
+		Capabilities: []*csi.NodeServiceCapability{
+			capability(csi.NodeServiceCapability_RPC_STAGE_UNSTAGE_VOLUME),
+		},
+	}, nil
+}
+
+// optsFromVolumeContext builds the opts map Mount expects out of the CSI
+// VolumeContext and NodePublishSecrets. Every secret is copied in after the
+// VolumeContext keys, so a secret overrides a VolumeContext value of the
+// same name; username and password are still accepted from VolumeContext
+// when no secret supplies them.
+func optsFromVolumeContext(volumeContext, secrets map[string]string) map[string]interface{} {
+	opts := map[string]interface{}{}
+	for _, key := range volumeContextKeys {
+		if v, ok := volumeContext[key]; ok {
+			opts[key] = v
+		}
+	}
+	for k, v := range secrets {
+		opts[k] = v
+	}
+	return opts
+}
+
+func (n *nodeServer) NodeStageVolume(ctx context.Context, req *csi.NodeStageVolumeRequest) (*csi.NodeStageVolumeResponse, error) {
+	if req.GetStagingTargetPath() == "" {
+		return nil, fmt.Errorf("staging target path is required")
+	}
+
+	source, _ := req.GetVolumeContext()["source"]
+	opts := optsFromVolumeContext(req.GetVolumeContext(), req.GetSecrets())
+
+	tempConfig := n.config.Copy()
+	if err := tempConfig.SetEntries(opts, []string{"source"}); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(req.GetStagingTargetPath(), 0700); err != nil {
+		return nil, err
+	}
+
+	env := driverhttp.NewHttpDriverEnv(n.logger, ctx)
+	if err := n.mounter.Mount(env, source, req.GetStagingTargetPath(), opts); err != nil {
+		return nil, err
+	}
+
+	return &csi.NodeStageVolumeResponse{}, nil
+}
+
+func (n *nodeServer) NodeUnstageVolume(ctx context.Context, req *csi.NodeUnstageVolumeRequest) (*csi.NodeUnstageVolumeResponse, error) {
+	env := driverhttp.NewHttpDriverEnv(n.logger, ctx)
+	if err := n.mounter.Unmount(env, req.GetStagingTargetPath()); err != nil {
+		return nil, err
+	}
+	return &csi.NodeUnstageVolumeResponse{}, nil
+}
+
+// NodePublishVolume bind-mounts the already-staged share into the pod's
+// target path. The actual cifs mount happened in NodeStageVolume; this just
+// needs a plain bind mount, which goes through the mounter's bindMounter
+// escape hatch rather than Mount (whose cifs option validation a bind mount
+// would never satisfy).
+func (n *nodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (*csi.NodePublishVolumeResponse, error) {
+	if req.GetTargetPath() == "" {
+		return nil, fmt.Errorf("target path is required")
+	}
+
+	bm, ok := n.mounter.(bindMounter)
+	if !ok {
+		return nil, fmt.Errorf("mounter does not support bind mounts")
+	}
+
+	source := req.GetStagingTargetPath()
+
+	if err := os.MkdirAll(req.GetTargetPath(), 0700); err != nil {
+		return nil, err
+	}
+
+	env := driverhttp.NewHttpDriverEnv(n.logger, ctx)
+	if err := bm.BindMount(env, source, req.GetTargetPath()); err != nil {
+		return nil, err
+	}
+
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+func (n *nodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
+	env := driverhttp.NewHttpDriverEnv(n.logger, ctx)
+	if err := n.mounter.Unmount(env, req.GetTargetPath()); err != nil {
+		return nil, err
+	}
+	return &csi.NodeUnpublishVolumeResponse{}, nil
+}
@@ -0,0 +1,81 @@
+package csi
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/volumedriver/volumedriverfakes"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeBindMounter adds a BindMount to volumedriverfakes.FakeMounter so tests
+// can exercise the bindMounter escape hatch NodePublishVolume uses.
+type fakeBindMounter struct {
+	*volumedriverfakes.FakeMounter
+
+	bindSource string
+	bindTarget string
+	bindErr    error
+}
+
+func (f *fakeBindMounter) BindMount(env dockerdriver.Env, source, target string) error {
+	f.bindSource = source
+	f.bindTarget = target
+	return f.bindErr
+}
+
+var _ = Describe("nodeServer#NodePublishVolume", func() {
+	var (
+		mounter           *fakeBindMounter
+		server            *nodeServer
+		stagingTargetPath string
+		podTargetPath     string
+	)
+
+	BeforeEach(func() {
+		root, err := ioutil.TempDir("", "smbcsi-node-publish")
+		Expect(err).NotTo(HaveOccurred())
+
+		stagingTargetPath = filepath.Join(root, "staging")
+		podTargetPath = filepath.Join(root, "pod-target")
+
+		mounter = &fakeBindMounter{FakeMounter: &volumedriverfakes.FakeMounter{}}
+		server = &nodeServer{
+			logger:  lagertest.NewTestLogger("smbcsi-node"),
+			mounter: mounter,
+			nodeID:  "node-1",
+		}
+	})
+
+	Context("when the mounter supports bind mounts", func() {
+		It("bind-mounts the staging path onto the target path", func() {
+			_, err := server.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+				StagingTargetPath: stagingTargetPath,
+				TargetPath:        podTargetPath,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(mounter.bindSource).To(Equal(stagingTargetPath))
+			Expect(mounter.bindTarget).To(Equal(podTargetPath))
+		})
+	})
+
+	Context("when the mounter doesn't support bind mounts", func() {
+		BeforeEach(func() {
+			server.mounter = &volumedriverfakes.FakeMounter{}
+		})
+
+		It("errors instead of calling Mount with bogus cifs options", func() {
+			_, err := server.NodePublishVolume(context.Background(), &csi.NodePublishVolumeRequest{
+				StagingTargetPath: stagingTargetPath,
+				TargetPath:        podTargetPath,
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(server.mounter.(*volumedriverfakes.FakeMounter).MountCallCount()).To(BeZero())
+		})
+	})
+})
@@ -0,0 +1,47 @@
+package csi_test
+
+import (
+	"io/ioutil"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/smbdriver"
+	smbcsi "code.cloudfoundry.org/smbdriver/csi"
+	"code.cloudfoundry.org/volumedriver/volumedriverfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Driver", func() {
+	var (
+		logger      *lagertest.TestLogger
+		fakeMounter *volumedriverfakes.FakeMounter
+		config      *smbdriver.Config
+		driver      *smbcsi.Driver
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("smbcsi")
+		fakeMounter = &volumedriverfakes.FakeMounter{}
+
+		config = smbdriver.NewSmbConfig()
+		Expect(config.ReadConf("source,username,password,vers", "", []string{"source"})).To(Succeed())
+
+		driver = smbcsi.NewDriver(logger, fakeMounter, config, "node-1")
+	})
+
+	It("builds a driver without error", func() {
+		Expect(driver).NotTo(BeNil())
+	})
+
+	It("runs against a throwaway socket and stops cleanly", func() {
+		dir, err := ioutil.TempDir("", "smbcsi-socket")
+		Expect(err).NotTo(HaveOccurred())
+
+		endpoint := dir + "/csi.sock"
+		done := make(chan error, 1)
+		go func() { done <- driver.Run(endpoint) }()
+
+		driver.Stop()
+		Expect(<-done).NotTo(HaveOccurred())
+	})
+})
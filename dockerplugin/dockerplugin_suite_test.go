@@ -0,0 +1,13 @@
+package dockerplugin_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestDockerplugin(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Dockerplugin Suite")
+}
@@ -0,0 +1,337 @@
+// Package dockerplugin serves the Docker managed-plugin volume API directly,
+// translating requests into calls on a volumedriver.Mounter so smbdriver can
+// run as a standalone `docker plugin install`-able plugin instead of only
+// through Cloud Foundry's dockerdriver/driverhttp bridge.
+package dockerplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/smbdriver"
+	"code.cloudfoundry.org/volumedriver"
+)
+
+const pluginContentType = "application/vnd.docker.plugins.v1.1+json"
+
+const defaultSocketDir = "/run/docker/plugins"
+
+// errInvalidVolumeName is returned when a request's volume Name can't be
+// trusted as a single path component of a filesystem path.
+var errInvalidVolumeName = errors.New("invalid volume name")
+
+// validVolumeName reports whether name is safe to use as a single path
+// component when building a volume's mountpoint. Docker's Name field comes
+// straight from whoever has access to the plugin socket, so a name like
+// "../../etc" must be rejected before it ever reaches filepath.Join -
+// otherwise it could make h.mount create directories (and mount an SMB
+// share into them) outside the volumes tree.
+func validVolumeName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// copyOpts returns a shallow copy of opts. smbMounter.Mount mutates its opts
+// argument in place (stripping username/password in favor of a credentials
+// file), and opts here is the same map stored in the registry's
+// volumeEntry.Opts - passing it through unchanged would let that mutation
+// leak into the persisted volumes.json, permanently losing the volume's
+// real options.
+func copyOpts(opts map[string]interface{}) map[string]interface{} {
+	cp := make(map[string]interface{}, len(opts))
+	for k, v := range opts {
+		cp[k] = v
+	}
+	return cp
+}
+
+// Handler implements the Docker volume plugin HTTP API on top of an existing
+// volumedriver.Mounter, so the same Mount/Unmount/Check/Purge implementation
+// backs both the Cloud Foundry dockerdriver bridge and a standalone plugin.
+type Handler struct {
+	logger  lager.Logger
+	mounter volumedriver.Mounter
+	config  *smbdriver.Config
+	reg     *registry
+}
+
+// NewHandler creates a Handler that persists volume state under stateDir.
+func NewHandler(logger lager.Logger, mounter volumedriver.Mounter, config *smbdriver.Config, stateDir string) (*Handler, error) {
+	reg, err := newRegistry(stateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handler{
+		logger:  logger.Session("dockerplugin"),
+		mounter: mounter,
+		config:  config,
+		reg:     reg,
+	}, nil
+}
+
+// Listen opens the Unix socket Docker's plugin loader expects for a plugin
+// named name (e.g. "smbdriver" -> /run/docker/plugins/smbdriver.sock) and
+// serves the API on it until the context is cancelled.
+func (h *Handler) Listen(ctx context.Context, name string) error {
+	socketPath := filepath.Join(defaultSocketDir, name+".sock")
+
+	if err := os.MkdirAll(defaultSocketDir, 0755); err != nil {
+		return err
+	}
+	_ = os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: h}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	h.logger.Info("listening", lager.Data{"socket": socketPath})
+	err = server.Serve(listener)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// ServeHTTP implements http.Handler so a Handler can be used directly with
+// http.Server, or wrapped by tests with httptest.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.router().ServeHTTP(w, r)
+}
+
+func (h *Handler) router() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Plugin.Activate", h.activate)
+	mux.HandleFunc("/VolumeDriver.Create", h.create)
+	mux.HandleFunc("/VolumeDriver.Get", h.get)
+	mux.HandleFunc("/VolumeDriver.List", h.list)
+	mux.HandleFunc("/VolumeDriver.Remove", h.remove)
+	mux.HandleFunc("/VolumeDriver.Path", h.path)
+	mux.HandleFunc("/VolumeDriver.Mount", h.mount)
+	mux.HandleFunc("/VolumeDriver.Unmount", h.unmount)
+	mux.HandleFunc("/VolumeDriver.Capabilities", h.capabilities)
+	return mux
+}
+
+func (h *Handler) reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", pluginContentType)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (h *Handler) activate(w http.ResponseWriter, r *http.Request) {
+	h.reply(w, struct {
+		Implements []string
+	}{Implements: []string{"VolumeDriver"}})
+}
+
+type createRequest struct {
+	Name string
+	Opts map[string]interface{}
+}
+
+type errResponse struct {
+	Err string
+}
+
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.reply(w, errResponse{Err: err.Error()})
+		return
+	}
+
+	if !validVolumeName(req.Name) {
+		h.reply(w, errResponse{Err: errInvalidVolumeName.Error()})
+		return
+	}
+
+	source, _ := req.Opts["share"].(string)
+	delete(req.Opts, "share")
+
+	tempConfig := h.config.Copy()
+	if err := tempConfig.SetEntries(req.Opts, []string{}); err != nil {
+		h.reply(w, errResponse{Err: err.Error()})
+		return
+	}
+
+	if err := h.reg.create(req.Name, source, req.Opts); err != nil {
+		h.reply(w, errResponse{Err: err.Error()})
+		return
+	}
+
+	h.reply(w, errResponse{})
+}
+
+type nameRequest struct {
+	Name string
+}
+
+type volumeResponse struct {
+	Volume struct {
+		Name       string
+		Mountpoint string
+	}
+	Err string
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	var req nameRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	v, ok := h.reg.get(req.Name)
+	if !ok {
+		h.reply(w, volumeResponse{Err: "volume not found"})
+		return
+	}
+
+	var resp volumeResponse
+	resp.Volume.Name = v.Name
+	resp.Volume.Mountpoint = v.Mountpoint
+	h.reply(w, resp)
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	type listVolume struct {
+		Name       string
+		Mountpoint string
+	}
+
+	resp := struct {
+		Volumes []listVolume
+		Err     string
+	}{}
+
+	for _, v := range h.reg.list() {
+		resp.Volumes = append(resp.Volumes, listVolume{Name: v.Name, Mountpoint: v.Mountpoint})
+	}
+
+	h.reply(w, resp)
+}
+
+func (h *Handler) remove(w http.ResponseWriter, r *http.Request) {
+	var req nameRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	if err := h.reg.remove(req.Name); err != nil {
+		h.reply(w, errResponse{Err: err.Error()})
+		return
+	}
+
+	h.reply(w, errResponse{})
+}
+
+func (h *Handler) path(w http.ResponseWriter, r *http.Request) {
+	var req nameRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	v, ok := h.reg.get(req.Name)
+	if !ok {
+		h.reply(w, volumeResponse{Err: "volume not found"})
+		return
+	}
+
+	var resp volumeResponse
+	resp.Volume.Mountpoint = v.Mountpoint
+	h.reply(w, resp)
+}
+
+type mountRequest struct {
+	Name string
+	ID   string
+}
+
+type mountResponse struct {
+	Mountpoint string
+	Err        string
+}
+
+func (h *Handler) mount(w http.ResponseWriter, r *http.Request) {
+	var req mountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.reply(w, mountResponse{Err: err.Error()})
+		return
+	}
+
+	if !validVolumeName(req.Name) {
+		h.reply(w, mountResponse{Err: errInvalidVolumeName.Error()})
+		return
+	}
+
+	v, ok := h.reg.get(req.Name)
+	if !ok {
+		h.reply(w, mountResponse{Err: "volume not found"})
+		return
+	}
+
+	target := filepath.Join(defaultSocketDir, "..", "volumes", req.Name, "_data")
+
+	if err := os.MkdirAll(target, 0700); err != nil {
+		h.reply(w, mountResponse{Err: err.Error()})
+		return
+	}
+
+	env := driverhttp.NewHttpDriverEnv(h.logger, r.Context())
+
+	if err := h.mounter.Mount(env, v.Source, target, copyOpts(v.Opts)); err != nil {
+		h.reply(w, mountResponse{Err: err.Error()})
+		return
+	}
+
+	if _, err := h.reg.mount(req.Name, target); err != nil {
+		h.reply(w, mountResponse{Err: err.Error()})
+		return
+	}
+
+	h.reply(w, mountResponse{Mountpoint: target})
+}
+
+func (h *Handler) unmount(w http.ResponseWriter, r *http.Request) {
+	var req mountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.reply(w, errResponse{Err: err.Error()})
+		return
+	}
+
+	v, ok := h.reg.get(req.Name)
+	if !ok {
+		h.reply(w, errResponse{Err: "volume not found"})
+		return
+	}
+
+	env := driverhttp.NewHttpDriverEnv(h.logger, r.Context())
+	if err := h.mounter.Unmount(env, v.Mountpoint); err != nil {
+		if _, safe := err.(dockerdriver.SafeError); !safe {
+			h.reply(w, errResponse{Err: err.Error()})
+			return
+		}
+	}
+
+	if _, err := h.reg.unmount(req.Name); err != nil {
+		h.reply(w, errResponse{Err: err.Error()})
+		return
+	}
+
+	h.reply(w, errResponse{})
+}
+
+func (h *Handler) capabilities(w http.ResponseWriter, r *http.Request) {
+	h.reply(w, struct {
+		Capabilities struct{ Scope string }
+	}{Capabilities: struct{ Scope string }{Scope: "local"}})
+}
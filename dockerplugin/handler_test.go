@@ -0,0 +1,81 @@
+package dockerplugin_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/lager/lagertest"
+	"code.cloudfoundry.org/smbdriver"
+	"code.cloudfoundry.org/smbdriver/dockerplugin"
+	"code.cloudfoundry.org/volumedriver/volumedriverfakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handler", func() {
+	var (
+		logger      *lagertest.TestLogger
+		fakeMounter *volumedriverfakes.FakeMounter
+		config      *smbdriver.Config
+		handler     *dockerplugin.Handler
+		stateDir    string
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("dockerplugin")
+		fakeMounter = &volumedriverfakes.FakeMounter{}
+
+		config = smbdriver.NewSmbConfig()
+		Expect(config.ReadConf("username,password,vers", "", []string{})).To(Succeed())
+
+		var err error
+		stateDir, err = ioutil.TempDir("", "dockerplugin-state")
+		Expect(err).NotTo(HaveOccurred())
+
+		handler, err = dockerplugin.NewHandler(logger, fakeMounter, config, stateDir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	post := func(path string, body interface{}) map[string]interface{} {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewReader(payload))
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		var resp map[string]interface{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	Describe("Create then Mount then Unmount", func() {
+		It("creates a volume and round-trips a mount", func() {
+			resp := post("/VolumeDriver.Create", map[string]interface{}{
+				"Name": "my-volume",
+				"Opts": map[string]interface{}{"share": "//host/share", "username": "u", "password": "p"},
+			})
+			Expect(resp["Err"]).To(BeEmpty())
+
+			fakeMounter.MountReturns(nil)
+
+			resp = post("/VolumeDriver.Mount", map[string]interface{}{"Name": "my-volume", "ID": "id-1"})
+			Expect(resp["Err"]).To(BeEmpty())
+			Expect(resp["Mountpoint"]).NotTo(BeEmpty())
+			Expect(fakeMounter.MountCallCount()).To(Equal(1))
+
+			resp = post("/VolumeDriver.Unmount", map[string]interface{}{"Name": "my-volume", "ID": "id-1"})
+			Expect(resp["Err"]).To(BeEmpty())
+			Expect(fakeMounter.UnmountCallCount()).To(Equal(1))
+		})
+
+		It("rejects disallowed options", func() {
+			resp := post("/VolumeDriver.Create", map[string]interface{}{
+				"Name": "bad-volume",
+				"Opts": map[string]interface{}{"share": "//host/share", "bogus": "x"},
+			})
+			Expect(resp["Err"]).NotTo(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,158 @@
+package dockerplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// volumeEntry is the persisted record for a single Docker-managed volume.
+type volumeEntry struct {
+	Name       string                 `json:"name"`
+	Source     string                 `json:"source"`
+	Opts       map[string]interface{} `json:"opts"`
+	Mountpoint string                 `json:"mountpoint"`
+	Mounted    int                    `json:"mounted"`
+}
+
+// registry is an in-memory table of known volumes that is flushed to disk on
+// every mutation so the plugin can rebuild its view of the world after a
+// restart without relying on the daemon to re-issue Create calls.
+type registry struct {
+	mu       sync.Mutex
+	path     string
+	volumes  map[string]*volumeEntry
+}
+
+func newRegistry(stateDir string) (*registry, error) {
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return nil, err
+	}
+
+	r := &registry{
+		path:    filepath.Join(stateDir, "volumes.json"),
+		volumes: map[string]*volumeEntry{},
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *registry) load() error {
+	bytes, err := os.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var volumes map[string]*volumeEntry
+	if err := json.Unmarshal(bytes, &volumes); err != nil {
+		return err
+	}
+	r.volumes = volumes
+	return nil
+}
+
+// save must be called with r.mu held.
+func (r *registry) save() error {
+	bytes, err := json.Marshal(r.volumes)
+	if err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, bytes, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+func (r *registry) create(name, source string, opts map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.volumes[name]; ok {
+		return fmt.Errorf("volume %s already exists", name)
+	}
+
+	r.volumes[name] = &volumeEntry{Name: name, Source: source, Opts: opts}
+	return r.save()
+}
+
+func (r *registry) get(name string) (*volumeEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.volumes[name]
+	return v, ok
+}
+
+func (r *registry) list() []*volumeEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	all := make([]*volumeEntry, 0, len(r.volumes))
+	for _, v := range r.volumes {
+		all = append(all, v)
+	}
+	return all
+}
+
+func (r *registry) remove(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.volumes[name]
+	if !ok {
+		return fmt.Errorf("volume %s not found", name)
+	}
+	if v.Mounted > 0 {
+		return fmt.Errorf("volume %s is still mounted", name)
+	}
+
+	delete(r.volumes, name)
+	return r.save()
+}
+
+// mount bumps the refcount and records the mountpoint the first time a
+// volume is mounted; subsequent calls are no-ops on the mountpoint.
+func (r *registry) mount(name, mountpoint string) (*volumeEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.volumes[name]
+	if !ok {
+		return nil, fmt.Errorf("volume %s not found", name)
+	}
+
+	if v.Mounted == 0 {
+		v.Mountpoint = mountpoint
+	}
+	v.Mounted++
+	return v, r.save()
+}
+
+func (r *registry) unmount(name string) (*volumeEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.volumes[name]
+	if !ok {
+		return nil, fmt.Errorf("volume %s not found", name)
+	}
+
+	if v.Mounted > 0 {
+		v.Mounted--
+	}
+	if v.Mounted == 0 {
+		v.Mountpoint = ""
+	}
+	return v, r.save()
+}
@@ -0,0 +1,55 @@
+package mount
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ExecMounter preserves the original behavior of shelling out to the
+// mount/umount binaries. It's kept around for platforms (or kernels) that
+// can't mount cifs shares via a direct syscall.
+type ExecMounter struct{}
+
+// Mount shells out to `mount -t fstype -o options... source target`.
+func (e *ExecMounter) Mount(source, target, fstype string, options []string) error {
+	args := []string{"-t", fstype}
+	if len(options) > 0 {
+		args = append(args, "-o", strings.Join(options, ","))
+	}
+	args = append(args, source, target)
+
+	out, err := exec.Command("mount", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("mount failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Unmount shells out to `umount [-f] [-l] target`: MntForce adds -f and
+// MntDetach adds -l. Other flag bits aren't representable on the command
+// line and are ignored.
+func (e *ExecMounter) Unmount(target string, flags int) error {
+	args := []string{}
+	if flags&MntForce != 0 {
+		args = append(args, "-f")
+	}
+	if flags&MntDetach != 0 {
+		args = append(args, "-l")
+	}
+	args = append(args, target)
+
+	out, err := exec.Command("umount", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("umount failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// IsLikelyNotMountPoint shells out to `mountpoint -q target`, preserving
+// the behavior the driver relied on before LinuxMounter learned to check
+// st_dev directly.
+func (e *ExecMounter) IsLikelyNotMountPoint(target string) (bool, error) {
+	err := exec.Command("mountpoint", "-q", target).Run()
+	return err != nil, nil
+}
@@ -0,0 +1,23 @@
+package mount_test
+
+import (
+	"code.cloudfoundry.org/smbdriver/mount"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExecMounter", func() {
+	var mounter *mount.ExecMounter
+
+	BeforeEach(func() {
+		mounter = &mount.ExecMounter{}
+	})
+
+	Describe("Unmount", func() {
+		It("returns a umount failed error when umount fails", func() {
+			err := mounter.Unmount("/no/such/target", mount.MntForce|mount.MntDetach)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("umount failed"))
+		})
+	})
+})
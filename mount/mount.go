@@ -0,0 +1,41 @@
+// Package mount is modeled on Kubernetes' pkg/util/mount: it exposes a small
+// Interface over the mount/unmount/mountpoint-check operations so callers
+// can talk to the kernel directly via syscalls on platforms that support
+// it, fall back to shelling out to the mount/umount binaries where they
+// can't, and inject a fake in tests without going through a generic
+// command-invoker fake.
+package mount
+
+// Interface abstracts mounting a filesystem, unmounting it, and checking
+// whether a path is currently a mountpoint.
+type Interface interface {
+	// Mount mounts source onto target as fstype with the given options
+	// (the same strings that would otherwise follow `-o` on a mount(8)
+	// command line).
+	Mount(source, target, fstype string, options []string) error
+
+	// Unmount unmounts target. flags is passed through to the underlying
+	// umount2(2) syscall (e.g. MntDetach); ExecMounter maps MntForce and
+	// MntDetach onto umount(8)'s -f and -l flags.
+	Unmount(target string, flags int) error
+
+	// IsLikelyNotMountPoint returns true if target is determined not to be
+	// a mountpoint. It errs on the side of "not a mountpoint" if it can't
+	// tell, the same convention Kubernetes' mount.Interface uses.
+	IsLikelyNotMountPoint(target string) (bool, error)
+}
+
+// MntDetach matches Linux's MNT_DETACH: perform a lazy unmount, so the
+// mount is detached from the namespace immediately but the underlying
+// filesystem isn't unmounted until it's no longer busy.
+const MntDetach = 2
+
+// MntForce matches Linux's MNT_FORCE: force an unmount even if the
+// filesystem is busy.
+const MntForce = 1
+
+// New returns the preferred Interface implementation for the current
+// platform.
+func New() Interface {
+	return newDefault()
+}
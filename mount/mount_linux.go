@@ -0,0 +1,55 @@
+package mount
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func newDefault() Interface {
+	return &LinuxMounter{}
+}
+
+// LinuxMounter calls unix.Mount/unix.Unmount directly instead of shelling
+// out to the mount/umount binaries via invoker.Invoke.
+type LinuxMounter struct{}
+
+// Mount mounts source onto target as fstype with options joined the same
+// way the mount(8) `-o` argument would be. As with mount(8), a "bind" option
+// is special: it's translated into the MS_BIND flag rather than passed
+// through as mount data, since bind mounts ignore fstype and most other
+// options entirely.
+func (m *LinuxMounter) Mount(source, target, fstype string, options []string) error {
+	var flags uintptr
+	data := make([]string, 0, len(options))
+	for _, option := range options {
+		if option == "bind" {
+			flags |= unix.MS_BIND
+			continue
+		}
+		data = append(data, option)
+	}
+
+	return unix.Mount(source, target, fstype, flags, strings.Join(data, ","))
+}
+
+// Unmount unmounts target, passing flags straight through to umount2(2).
+func (m *LinuxMounter) Unmount(target string, flags int) error {
+	return unix.Unmount(target, flags)
+}
+
+// IsLikelyNotMountPoint stats target and its parent and compares st_dev:
+// if they're on the same device, target isn't a separate mount.
+func (m *LinuxMounter) IsLikelyNotMountPoint(target string) (bool, error) {
+	var targetStat unix.Stat_t
+	if err := unix.Stat(target, &targetStat); err != nil {
+		return true, err
+	}
+
+	var parentStat unix.Stat_t
+	if err := unix.Stat(target+"/..", &parentStat); err != nil {
+		return true, err
+	}
+
+	return targetStat.Dev == parentStat.Dev, nil
+}
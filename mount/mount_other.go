@@ -0,0 +1,7 @@
+// +build !linux
+
+package mount
+
+func newDefault() Interface {
+	return &ExecMounter{}
+}
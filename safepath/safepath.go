@@ -0,0 +1,53 @@
+// Package safepath resolves a caller-supplied path one component at a time
+// from a trusted anchor directory, refusing to follow symlinks and refusing
+// any component that would escape the anchor. It exists so that a
+// compromised container sharing a mount directory with the driver can't
+// plant a symlink that redirects a later Purge into deleting host files, or
+// redirects an Unmount/Mount onto an unrelated mountpoint.
+package safepath
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrEscapesAnchor is returned when a path component (directly, or via
+// "..") would resolve outside of the resolver's anchor directory.
+var ErrEscapesAnchor = errors.New("safepath: path escapes anchor directory")
+
+// ErrSymlink is returned when a path component is a symlink. safepath never
+// follows symlinks while resolving a target.
+var ErrSymlink = errors.New("safepath: path component is a symlink")
+
+// Handle is a resolved, symlink-free reference to a path. It wraps an open
+// file descriptor rather than a string so that subsequent operations race
+// against the same inode the resolution walked to, not whatever a later
+// lookup of the path string happens to find.
+type Handle struct {
+	file *os.File
+}
+
+// Path returns a path that refers to the resolved handle itself
+// (/proc/self/fd/N on Linux, /dev/fd/N on Darwin, the handle's final path
+// name on Windows). Operations
+// that take a path argument (mount(2), umount2(2), os.Remove) should use
+// this instead of the original caller-supplied path.
+func (h *Handle) Path() string {
+	return procSelfFd(h.file.Fd())
+}
+
+// Close releases the underlying file descriptor.
+func (h *Handle) Close() error {
+	return h.file.Close()
+}
+
+// Resolver resolves paths relative to a fixed anchor directory.
+type Resolver struct {
+	anchor string
+}
+
+// NewResolver creates a Resolver rooted at anchor. anchor itself is trusted
+// and is not re-validated on each Resolve call.
+func NewResolver(anchor string) *Resolver {
+	return &Resolver{anchor: anchor}
+}
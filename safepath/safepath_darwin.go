@@ -0,0 +1,128 @@
+package safepath
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func procSelfFd(fd uintptr) string {
+	// Darwin has no /proc; /dev/fd is the BSD equivalent and is resolved by
+	// the kernel against the calling process's own descriptor table, same as
+	// /proc/self/fd on Linux.
+	return fmt.Sprintf("/dev/fd/%d", int(fd))
+}
+
+// Resolve walks target one path component at a time starting from the
+// resolver's anchor, opening each component with O_NOFOLLOW so a symlink
+// planted at any point along the way is rejected rather than followed.
+// Darwin has no O_PATH, so unlike safepath_linux.go each component is
+// opened for real (O_RDONLY) rather than as a path-only reference; every
+// component safepath resolves is expected to be a plain directory or mount
+// point, so this never actually reads file contents. Components that are
+// "." are skipped; ".." and absolute components are rejected outright
+// rather than resolved against the anchor's parent, since a legitimate
+// target is always a descendant of the anchor.
+func (r *Resolver) Resolve(target string) (*Handle, error) {
+	rel, err := filepath.Rel(r.anchor, target)
+	if err != nil {
+		return nil, err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return nil, ErrEscapesAnchor
+	}
+
+	anchorFd, err := unix.Open(r.anchor, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, err
+	}
+	anchorFile := os.NewFile(uintptr(anchorFd), r.anchor)
+	defer anchorFile.Close()
+
+	if rel == "." {
+		return r.dup(anchorFile)
+	}
+
+	components := strings.Split(filepath.Clean(rel), string(filepath.Separator))
+
+	dirFd := int(anchorFile.Fd())
+	var current *os.File
+
+	for i, comp := range components {
+		if comp == "" || comp == "." {
+			continue
+		}
+		if comp == ".." {
+			if current != nil {
+				current.Close()
+			}
+			return nil, ErrEscapesAnchor
+		}
+
+		var stat unix.Stat_t
+		if err := unix.Fstatat(dirFd, comp, &stat, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			if current != nil {
+				current.Close()
+			}
+			return nil, err
+		}
+		if stat.Mode&unix.S_IFMT == unix.S_IFLNK {
+			if current != nil {
+				current.Close()
+			}
+			return nil, ErrSymlink
+		}
+
+		flags := unix.O_RDONLY | unix.O_NOFOLLOW
+		last := i == len(components)-1
+		if !last {
+			flags |= unix.O_DIRECTORY
+		}
+
+		fd, err := unix.Openat(dirFd, comp, flags, 0)
+		if err != nil {
+			if current != nil {
+				current.Close()
+			}
+			return nil, fmt.Errorf("safepath: openat %q: %w", comp, err)
+		}
+
+		if current != nil {
+			current.Close()
+		}
+		current = os.NewFile(uintptr(fd), comp)
+		dirFd = fd
+	}
+
+	if current == nil {
+		return r.dup(anchorFile)
+	}
+
+	return &Handle{file: current}, nil
+}
+
+func (r *Resolver) dup(f *os.File) (*Handle, error) {
+	newFd, err := unix.Dup(int(f.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	return &Handle{file: os.NewFile(uintptr(newFd), f.Name())}, nil
+}
+
+// Mkdirat creates name under the resolved parent handle.
+func Mkdirat(parent *Handle, name string, mode uint32) error {
+	return unix.Mkdirat(int(parent.file.Fd()), name, mode)
+}
+
+// Unlinkat removes name under the resolved parent handle. If dir is true,
+// name is removed as a directory (AT_REMOVEDIR).
+func Unlinkat(parent *Handle, name string, dir bool) error {
+	flags := 0
+	if dir {
+		flags = unix.AT_REMOVEDIR
+	}
+	return unix.Unlinkat(int(parent.file.Fd()), name, flags)
+}
@@ -0,0 +1,131 @@
+package safepath
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+func procSelfFd(fd uintptr) string {
+	return fmt.Sprintf("/proc/self/fd/%d", int(fd))
+}
+
+// Resolve walks target one path component at a time starting from the
+// resolver's anchor, opening each component with O_NOFOLLOW|O_PATH so a
+// symlink planted at any point along the way is rejected rather than
+// followed. Components that are "." are skipped; ".." and absolute
+// components are rejected outright rather than resolved against the
+// anchor's parent, since a legitimate target is always a descendant of the
+// anchor.
+func (r *Resolver) Resolve(target string) (*Handle, error) {
+	rel, err := filepath.Rel(r.anchor, target)
+	if err != nil {
+		return nil, err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return nil, ErrEscapesAnchor
+	}
+
+	anchorFd, err := unix.Open(r.anchor, unix.O_PATH|unix.O_DIRECTORY|unix.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, err
+	}
+	anchorFile := os.NewFile(uintptr(anchorFd), r.anchor)
+	defer anchorFile.Close()
+
+	if rel == "." {
+		return r.dup(anchorFile)
+	}
+
+	components := strings.Split(filepath.Clean(rel), string(filepath.Separator))
+
+	dirFd := int(anchorFile.Fd())
+	var current *os.File
+
+	for i, comp := range components {
+		if comp == "" || comp == "." {
+			continue
+		}
+		if comp == ".." {
+			if current != nil {
+				current.Close()
+			}
+			return nil, ErrEscapesAnchor
+		}
+
+		flags := unix.O_PATH | unix.O_NOFOLLOW
+		last := i == len(components)-1
+		if !last {
+			flags |= unix.O_DIRECTORY
+		}
+
+		fd, err := unix.Openat(dirFd, comp, flags, 0)
+		if err != nil {
+			// O_DIRECTORY makes a symlinked intermediate component fail with
+			// ENOTDIR rather than open, so check for a symlink here too.
+			var lstat unix.Stat_t
+			isLink := unix.Fstatat(dirFd, comp, &lstat, unix.AT_SYMLINK_NOFOLLOW) == nil && lstat.Mode&unix.S_IFMT == unix.S_IFLNK
+			if current != nil {
+				current.Close()
+			}
+			if isLink {
+				return nil, ErrSymlink
+			}
+			return nil, fmt.Errorf("safepath: openat %q: %w", comp, err)
+		}
+
+		var stat unix.Stat_t
+		if err := unix.Fstatat(fd, "", &stat, unix.AT_EMPTY_PATH|unix.AT_SYMLINK_NOFOLLOW); err != nil {
+			unix.Close(fd)
+			if current != nil {
+				current.Close()
+			}
+			return nil, err
+		}
+		if stat.Mode&unix.S_IFMT == unix.S_IFLNK {
+			unix.Close(fd)
+			if current != nil {
+				current.Close()
+			}
+			return nil, ErrSymlink
+		}
+
+		if current != nil {
+			current.Close()
+		}
+		current = os.NewFile(uintptr(fd), comp)
+		dirFd = fd
+	}
+
+	if current == nil {
+		return r.dup(anchorFile)
+	}
+
+	return &Handle{file: current}, nil
+}
+
+func (r *Resolver) dup(f *os.File) (*Handle, error) {
+	newFd, err := unix.Dup(int(f.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	return &Handle{file: os.NewFile(uintptr(newFd), f.Name())}, nil
+}
+
+// Mkdirat creates name under the resolved parent handle.
+func Mkdirat(parent *Handle, name string, mode uint32) error {
+	return unix.Mkdirat(int(parent.file.Fd()), name, mode)
+}
+
+// Unlinkat removes name under the resolved parent handle. If dir is true,
+// name is removed as a directory (AT_REMOVEDIR).
+func Unlinkat(parent *Handle, name string, dir bool) error {
+	flags := 0
+	if dir {
+		flags = unix.AT_REMOVEDIR
+	}
+	return unix.Unlinkat(int(parent.file.Fd()), name, flags)
+}
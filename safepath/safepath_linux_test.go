@@ -0,0 +1,59 @@
+// +build linux
+
+package safepath_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/smbdriver/safepath"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Resolver", func() {
+	var anchor string
+
+	BeforeEach(func() {
+		var err error
+		anchor, err = ioutil.TempDir("", "safepath")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		_ = os.RemoveAll(anchor)
+	})
+
+	Context("when the target is a plain descendant of the anchor", func() {
+		It("resolves successfully", func() {
+			Expect(os.MkdirAll(filepath.Join(anchor, "a", "b"), 0755)).To(Succeed())
+
+			resolver := safepath.NewResolver(anchor)
+			handle, err := resolver.Resolve(filepath.Join(anchor, "a", "b"))
+			Expect(err).NotTo(HaveOccurred())
+			defer handle.Close()
+
+			Expect(handle.Path()).To(ContainSubstring("/proc/self/fd/"))
+		})
+	})
+
+	Context("when a path component is a symlink", func() {
+		It("refuses to follow it", func() {
+			Expect(os.MkdirAll(filepath.Join(anchor, "real"), 0755)).To(Succeed())
+			Expect(os.Symlink(filepath.Join(anchor, "real"), filepath.Join(anchor, "link"))).To(Succeed())
+
+			resolver := safepath.NewResolver(anchor)
+			_, err := resolver.Resolve(filepath.Join(anchor, "link"))
+			Expect(err).To(MatchError(safepath.ErrSymlink))
+		})
+	})
+
+	Context("when the target escapes the anchor via ..", func() {
+		It("refuses to resolve it", func() {
+			resolver := safepath.NewResolver(anchor)
+			_, err := resolver.Resolve(filepath.Join(anchor, "..", "etc", "passwd"))
+			Expect(err).To(MatchError(safepath.ErrEscapesAnchor))
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package safepath_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSafepath(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Safepath Suite")
+}
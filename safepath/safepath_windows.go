@@ -0,0 +1,89 @@
+package safepath
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// procSelfFd has no Windows equivalent to return directly (there's no /proc
+// to hand a magic path through), so it asks the kernel for the final,
+// symlink/reparse-point-free path backing fd itself via
+// GetFinalPathNameByHandle - that's the same resolved file the handle was
+// opened against, not a fresh lookup of the original string, so a reparse
+// point swapped in after Resolve already ran can't redirect it.
+func procSelfFd(fd uintptr) string {
+	h := windows.Handle(fd)
+
+	buf := make([]uint16, windows.MAX_PATH)
+	n, err := windows.GetFinalPathNameByHandle(h, &buf[0], uint32(len(buf)), 0)
+	if err != nil {
+		return ""
+	}
+	if int(n) > len(buf) {
+		buf = make([]uint16, n)
+		if _, err := windows.GetFinalPathNameByHandle(h, &buf[0], uint32(len(buf)), 0); err != nil {
+			return ""
+		}
+	}
+
+	return windows.UTF16ToString(buf)
+}
+
+// Resolve walks target one path component at a time starting from the
+// resolver's anchor, checking each component with os.Lstat and rejecting
+// any that is a symlink with ErrSymlink. Only the final path is then opened,
+// with CreateFile using FILE_FLAG_OPEN_REPARSE_POINT, so a reparse point at
+// that path is opened as itself rather than followed.
+func (r *Resolver) Resolve(target string) (*Handle, error) {
+	rel, err := filepath.Rel(r.anchor, target)
+	if err != nil {
+		return nil, err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return nil, ErrEscapesAnchor
+	}
+
+	current := r.anchor
+	if rel != "." {
+		for _, comp := range strings.Split(filepath.Clean(rel), string(filepath.Separator)) {
+			if comp == "" || comp == "." {
+				continue
+			}
+			if comp == ".." {
+				return nil, ErrEscapesAnchor
+			}
+			current = filepath.Join(current, comp)
+
+			info, err := os.Lstat(current)
+			if err != nil {
+				return nil, err
+			}
+			if info.Mode()&os.ModeSymlink != 0 {
+				return nil, ErrSymlink
+			}
+		}
+	}
+
+	pathPtr, err := windows.UTF16PtrFromString(current)
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := windows.CreateFile(
+		pathPtr,
+		windows.GENERIC_READ,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE,
+		nil,
+		windows.OPEN_EXISTING,
+		windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OPEN_REPARSE_POINT,
+		0,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Handle{file: os.NewFile(uintptr(handle), current)}, nil
+}
@@ -0,0 +1,138 @@
+package smbdriver
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// mountRefEntry is the persisted refcount record for a single source share.
+type mountRefEntry struct {
+	Target   string `json:"target"`
+	RefCount int    `json:"ref_count"`
+}
+
+// mountRefTracker maps a mount source to the target it's mounted at and how
+// many callers currently hold a reference to it. It exists so that Mount
+// doesn't re-invoke mount(2) for a source that's already mounted at the
+// same target, and so Unmount doesn't tear a mount down out from under a
+// second caller that's still using it. A target the tracker has no record
+// of (including one whose mount never succeeded) is still unmounted; see
+// ReleaseTarget.
+type mountRefTracker struct {
+	mu   sync.Mutex
+	path string
+	refs map[string]*mountRefEntry
+}
+
+// newMountRefTracker loads any persisted refcounts from statePath (if it
+// exists) and rehydrates the rest from the running mount table, so a
+// restarted driver process doesn't forget about mounts that are still up.
+func newMountRefTracker(statePath string) *mountRefTracker {
+	t := &mountRefTracker{path: statePath, refs: map[string]*mountRefEntry{}}
+	_ = t.load()
+	t.rehydrateFromMountInfo()
+	return t
+}
+
+func (t *mountRefTracker) load() error {
+	bytes, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	refs := map[string]*mountRefEntry{}
+	if err := json.Unmarshal(bytes, &refs); err != nil {
+		return err
+	}
+	t.refs = refs
+	return nil
+}
+
+// save must be called with t.mu held.
+func (t *mountRefTracker) save() {
+	if t.path == "" {
+		return
+	}
+
+	bytes, err := json.Marshal(t.refs)
+	if err != nil {
+		return
+	}
+
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, bytes, 0600); err != nil {
+		return
+	}
+	_ = os.Rename(tmp, t.path)
+}
+
+// Acquire records an intent to mount source at target. If source is
+// already mounted at that target, its refcount is bumped and Acquire
+// returns true, telling the caller to skip the actual mount(2) call.
+// Acquire never creates an entry on its own (that only happens once the
+// mount syscall actually succeeds, via Confirm) so a failed mount never
+// leaves a stale refcount behind.
+func (t *mountRefTracker) Acquire(source, target string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.refs[source]
+	if !ok || entry.Target != target {
+		return false
+	}
+
+	entry.RefCount++
+	t.save()
+	return true
+}
+
+// Confirm records a mount of source at target that has just succeeded.
+func (t *mountRefTracker) Confirm(source, target string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.refs[source] = &mountRefEntry{Target: target, RefCount: 1}
+	t.save()
+}
+
+// ReleaseTarget decrements the refcount for whichever source is mounted at
+// target and reports whether it reached zero, meaning the caller should go
+// ahead and actually unmount. A target this tracker has no record of (e.g.
+// because it predates the tracker, or was never successfully mounted) is
+// treated as unreferenced so Unmount still behaves as a best-effort cleanup.
+func (t *mountRefTracker) ReleaseTarget(target string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for source, entry := range t.refs {
+		if entry.Target != target {
+			continue
+		}
+
+		entry.RefCount--
+		if entry.RefCount <= 0 {
+			delete(t.refs, source)
+		}
+		t.save()
+		return entry.RefCount <= 0
+	}
+
+	return true
+}
+
+// Debug returns a snapshot of the current refcount table for the HTTP admin
+// surface.
+func (t *mountRefTracker) Debug() map[string]mountRefEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := make(map[string]mountRefEntry, len(t.refs))
+	for source, entry := range t.refs {
+		snapshot[source] = *entry
+	}
+	return snapshot
+}
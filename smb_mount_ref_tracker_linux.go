@@ -0,0 +1,52 @@
+package smbdriver
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// rehydrateFromMountInfo parses /proc/self/mountinfo for cifs mounts that
+// aren't already accounted for in t.refs, so a driver restart picks up
+// mounts a previous process made without losing track of them. Entries
+// found this way start at refcount 1, since there's no way to recover how
+// many callers were actually sharing them.
+func (t *mountRefTracker) rehydrateFromMountInfo() {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		sep := -1
+		for i, field := range fields {
+			if field == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+
+		mountPoint := fields[4]
+		fstype := fields[sep+1]
+		mountSource := fields[sep+2]
+
+		if fstype != "cifs" {
+			continue
+		}
+		if _, known := t.refs[mountSource]; known {
+			continue
+		}
+
+		t.refs[mountSource] = &mountRefEntry{Target: mountPoint, RefCount: 1}
+	}
+}
@@ -0,0 +1,8 @@
+// +build !linux
+
+package smbdriver
+
+// rehydrateFromMountInfo is a no-op outside Linux: there's no
+// /proc/self/mountinfo to read, so the tracker only knows about mounts it
+// made itself since the process started.
+func (t *mountRefTracker) rehydrateFromMountInfo() {}
@@ -0,0 +1,346 @@
+// +build linux darwin
+
+package smbdriver
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/goshims/ioutilshim"
+	"code.cloudfoundry.org/goshims/osshim"
+	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/smbdriver/mount"
+	"code.cloudfoundry.org/smbdriver/safepath"
+	"code.cloudfoundry.org/volumedriver"
+)
+
+// credentialsFileOpt opts a single mount into credentials-file mode even
+// when the Config wasn't built with SetUseCredentialsFile(true).
+const credentialsFileOpt = "credentials_file"
+
+// smbMounter represent volumedriver.Mounter for SMB
+type smbMounter struct {
+	osutil      osshim.Os
+	ioutil      ioutilshim.Ioutil
+	config      Config
+	mountUtil   mount.Interface
+	refTracker  *mountRefTracker
+	volumesRoot string
+	scratchDir  string
+}
+
+// NewSmbMounter create SMB mounter. mountUtil is typically mount.New(),
+// which prefers talking to the kernel directly; tests inject a
+// mountfakes.FakeInterface instead. volumesRoot is the trusted, fixed
+// directory every Mount/Unmount/BindMount target is expected to live under
+// (e.g. "/var/vcap/data/volumes", or kubelet's pod volume root for the CSI
+// driver); safepath resolves every target against it, so a symlink planted
+// anywhere between volumesRoot and target is caught even for deeply nested
+// targets. stateDir is where the mount refcount table is persisted so it
+// survives a driver restart; pass "" to keep it in memory only (as tests
+// do). scratchDir is where credentials files are written; it's expected to
+// already be a tmpfs mount (the caller's responsibility, since mounting
+// tmpfs is a one-time setup step, not something to redo on every Mount) so
+// a plaintext credentials file never touches a disk-backed filesystem, even
+// briefly; pass "" to fall back to the OS default temp directory (as tests
+// do).
+func NewSmbMounter(osutil osshim.Os, ioutil ioutilshim.Ioutil, config *Config, mountUtil mount.Interface, volumesRoot string, stateDir string, scratchDir string) volumedriver.Mounter {
+	statePath := ""
+	if stateDir != "" {
+		statePath = filepath.Join(stateDir, "mount-refs.json")
+	}
+
+	return &smbMounter{
+		osutil:      osutil,
+		ioutil:      ioutil,
+		config:      *config,
+		mountUtil:   mountUtil,
+		refTracker:  newMountRefTracker(statePath),
+		volumesRoot: volumesRoot,
+		scratchDir:  scratchDir,
+	}
+}
+
+// Debug returns a snapshot of the mount refcount table, for an HTTP admin
+// surface to report on.
+func (m *smbMounter) Debug() map[string]mountRefEntry {
+	return m.refTracker.Debug()
+}
+
+// checkSafe resolves target as a child of anchor and rejects it if the
+// resolution finds a symlink along the way or a component that escapes the
+// anchor via "..". A target that simply doesn't exist yet (the common case
+// for a fresh mount point) is not itself suspicious and is allowed through;
+// only an actual symlink or anchor escape is treated as an attack. On
+// success it returns the open, symlink-free Handle rather than closing it,
+// so the caller can mount/unmount/remove via handle.Path() instead of
+// re-resolving the original string - otherwise a symlink swapped in right
+// after this check and before the real operation would defeat it entirely.
+// A nil, nil return means resolution failed for any other reason (most
+// often because the target doesn't exist yet), so there's nothing to hold
+// open; the caller falls back to the original target string.
+func (m *smbMounter) checkSafe(logger lager.Logger, anchor, target string) (*safepath.Handle, error) {
+	handle, err := safepath.NewResolver(anchor).Resolve(target)
+	if err != nil {
+		if errors.Is(err, safepath.ErrSymlink) || errors.Is(err, safepath.ErrEscapesAnchor) {
+			return nil, dockerdriver.SafeError{SafeDescription: fmt.Sprintf("refusing to operate on %s: %s", target, err.Error())}
+		}
+
+		logger.Debug("safepath-resolve-skipped", lager.Data{"target": target, "error": err.Error()})
+		return nil, nil
+	}
+	return handle, nil
+}
+
+// safePath returns the path operations should actually use: handle.Path()
+// (a /proc/self/fd or /dev/fd reference to the resolved, symlink-free target) if
+// checkSafe found one, or the original target string if the target didn't
+// exist yet to resolve.
+func safePath(handle *safepath.Handle, target string) string {
+	if handle == nil {
+		return target
+	}
+	return handle.Path()
+}
+
+// writeCredentialsFile writes a mount.cifs(8) credentials file so the
+// username/password never appear in the mount command's argv, where any
+// local user could read them via /proc/<pid>/cmdline. It's created under
+// scratchDir, a tmpfs mount, rather than the OS default temp directory, so
+// the plaintext credentials never touch a disk-backed filesystem. The file
+// is created with mode 0600 and the caller is responsible for removing it
+// once the mount has started.
+func (m *smbMounter) writeCredentialsFile(username, password, domain string) (string, error) {
+	f, err := m.ioutil.TempFile(m.scratchDir, "smb-credentials-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := m.osutil.Chmod(f.Name(), 0600); err != nil {
+		return "", err
+	}
+
+	contents := fmt.Sprintf("username=%s\npassword=%s\ndomain=%s\n", username, password, domain)
+	if _, err := f.WriteString(contents); err != nil {
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// Reference: https://www.samba.org/samba/docs/man/manpages-3/mount.cifs.8.html
+// Mount mount SMB folder to a local path
+func (m *smbMounter) Mount(env dockerdriver.Env, source string, target string, opts map[string]interface{}) error {
+	logger := env.Logger().Session("smb-mount")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	handle, err := m.checkSafe(logger, m.volumesRoot, target)
+	if err != nil {
+		return err
+	}
+	if handle != nil {
+		defer handle.Close()
+	}
+	mountTarget := safePath(handle, target)
+
+	if m.refTracker.Acquire(source, target) {
+		logger.Info("already-mounted", lager.Data{"source": source, "target": target})
+		return nil
+	}
+
+	tempConfig := m.config.Copy()
+	if err := tempConfig.SetEntries(opts, []string{"source", credentialsFileOpt}); err != nil {
+		logger.Debug("error-parse-entries", lager.Data{
+			"given_source":  source,
+			"given_target":  target,
+			"given_options": opts,
+		})
+		return err
+	}
+
+	useCredentialsFile := tempConfig.UseCredentialsFile()
+	if raw, ok := opts[credentialsFileOpt]; ok {
+		if b, ok := raw.(bool); ok {
+			useCredentialsFile = b
+		}
+		delete(opts, credentialsFileOpt)
+	}
+
+	if useCredentialsFile {
+		username, _ := opts["username"].(string)
+		password, _ := opts["password"].(string)
+		domain, _ := opts["domain"].(string)
+
+		credentialsPath, err := m.writeCredentialsFile(username, password, domain)
+		if err != nil {
+			return dockerdriver.SafeError{SafeDescription: err.Error()}
+		}
+		defer func() {
+			if err := m.osutil.Remove(credentialsPath); err != nil {
+				logger.Error("credentials-file-cleanup-failed", err, lager.Data{"path": credentialsPath})
+			}
+		}()
+
+		delete(opts, "username")
+		delete(opts, "password")
+		delete(opts, "domain")
+		opts["credentials"] = credentialsPath
+	}
+
+	var mountOptions []string
+	for k, v := range opts {
+		mountOptions = append(mountOptions, fmt.Sprintf("%s=%v", k, v))
+	}
+	if _, ok := opts["readonly"]; ok {
+		mountOptions = append(mountOptions, "ro")
+	}
+	if _, ok := opts["ro"]; ok {
+		mountOptions = append(mountOptions, "ro")
+	}
+
+	logger.Debug("mount", lager.Data{"options": mountOptions})
+
+	// If the caller's context is cancelled while the mount syscall is
+	// blocked (a wedged share can hang mount(2) for a long time), tear the
+	// mount back down instead of leaving it half-established with nobody
+	// watching it.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-env.Context().Done():
+			logger.Info("mount-cancelled", lager.Data{"target": target})
+			_ = m.mountUtil.Unmount(mountTarget, mount.MntDetach)
+		case <-done:
+		}
+	}()
+
+	if err := m.mountUtil.Mount(source, mountTarget, "cifs", mountOptions); err != nil {
+		return dockerdriver.SafeError{SafeDescription: err.Error()}
+	}
+
+	m.refTracker.Confirm(source, target)
+	return nil
+}
+
+// BindMount bind-mounts an already-mounted source (typically a staging path
+// this same mounter already Mount'd) onto target, bypassing the cifs option
+// validation and username/password/credentials-file handling in Mount
+// entirely, since a bind mount carries none of that. CSI's NodePublishVolume
+// uses this to project a staged share into a pod's target path.
+func (m *smbMounter) BindMount(env dockerdriver.Env, source, target string) error {
+	logger := env.Logger().Session("smb-bind-mount")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	handle, err := m.checkSafe(logger, m.volumesRoot, target)
+	if err != nil {
+		return err
+	}
+	if handle != nil {
+		defer handle.Close()
+	}
+	mountTarget := safePath(handle, target)
+
+	if m.refTracker.Acquire(source, target) {
+		logger.Info("already-mounted", lager.Data{"source": source, "target": target})
+		return nil
+	}
+
+	if err := m.mountUtil.Mount(source, mountTarget, "", []string{"bind"}); err != nil {
+		return dockerdriver.SafeError{SafeDescription: err.Error()}
+	}
+
+	m.refTracker.Confirm(source, target)
+	return nil
+}
+
+// Unmount unmount a SMB folder from a local path
+func (m *smbMounter) Unmount(env dockerdriver.Env, target string) error {
+	logger := env.Logger().Session("smb-umount")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	handle, err := m.checkSafe(logger, m.volumesRoot, target)
+	if err != nil {
+		return err
+	}
+	if handle != nil {
+		defer handle.Close()
+	}
+
+	if !m.refTracker.ReleaseTarget(target) {
+		logger.Info("still-referenced", lager.Data{"target": target})
+		return nil
+	}
+
+	if err := m.mountUtil.Unmount(safePath(handle, target), mount.MntDetach); err != nil {
+		return dockerdriver.SafeError{SafeDescription: err.Error()}
+	}
+	return nil
+}
+
+// Check check whether a local path is mounted or not
+func (m *smbMounter) Check(env dockerdriver.Env, name, mountPoint string) bool {
+	logger := env.Logger().Session("smb-check-mountpoint")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	notMountPoint, err := m.mountUtil.IsLikelyNotMountPoint(mountPoint)
+	if err != nil {
+		logger.Info(fmt.Sprintf("unable to verify volume %s (%s)", name, err.Error()))
+		return false
+	}
+	return !notMountPoint
+}
+
+// Purge delete all files in a local path
+func (m *smbMounter) Purge(env dockerdriver.Env, path string) {
+	logger := env.Logger().Session("purge")
+	logger.Info("start")
+	defer logger.Info("end")
+
+	fileInfos, err := m.ioutil.ReadDir(path)
+	if err != nil {
+		logger.Error("purge-readdir-failed", err, lager.Data{"path": path})
+		return
+	}
+
+	for _, fileInfo := range fileInfos {
+		if !fileInfo.IsDir() {
+			continue
+		}
+
+		m.purgeEntry(logger, path, fileInfo.Name())
+	}
+}
+
+// purgeEntry is split out from Purge so the handle returned by checkSafe can
+// be deferred-closed per entry instead of pinned open until the whole
+// directory has been walked.
+func (m *smbMounter) purgeEntry(logger lager.Logger, path, name string) {
+	entry := filepath.Join(path, name)
+
+	handle, err := m.checkSafe(logger, path, entry)
+	if err != nil {
+		logger.Error("purge-unsafe-entry", err, lager.Data{"name": name, "path": path})
+		return
+	}
+	if handle != nil {
+		defer handle.Close()
+	}
+	entryPath := safePath(handle, entry)
+
+	m.refTracker.ReleaseTarget(entry)
+	if err := m.mountUtil.Unmount(entryPath, mount.MntDetach|mount.MntForce); err != nil {
+		logger.Debug("purge-umount-failed", lager.Data{"name": name, "error": err.Error()})
+	}
+
+	if err := m.osutil.Remove(entryPath); err != nil {
+		logger.Error("purge-cannot-remove-directory", err, lager.Data{"name": name, "path": path})
+	}
+}
@@ -5,17 +5,20 @@ package smbdriver_test
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
-	"strings"
+	"path/filepath"
+	"time"
 
 	"code.cloudfoundry.org/dockerdriver"
-	"code.cloudfoundry.org/dockerdriver/dockerdriverfakes"
 	"code.cloudfoundry.org/dockerdriver/driverhttp"
 	"code.cloudfoundry.org/goshims/ioutilshim/ioutil_fake"
 	"code.cloudfoundry.org/goshims/osshim/os_fake"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
 	"code.cloudfoundry.org/smbdriver"
+	"code.cloudfoundry.org/smbdriver/mount"
+	"code.cloudfoundry.org/smbdriver/mount/mountfakes"
 	"code.cloudfoundry.org/volumedriver"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -28,9 +31,9 @@ var _ = Describe("SmbMounter", func() {
 		env         dockerdriver.Env
 		err         error
 
-		fakeInvoker *dockerdriverfakes.FakeInvoker
-		fakeIoutil  *ioutil_fake.FakeIoutil
-		fakeOs      *os_fake.FakeOs
+		fakeMountUtil *mountfakes.FakeInterface
+		fakeIoutil    *ioutil_fake.FakeIoutil
+		fakeOs        *os_fake.FakeOs
 
 		subject volumedriver.Mounter
 
@@ -43,20 +46,20 @@ var _ = Describe("SmbMounter", func() {
 		env = driverhttp.NewHttpDriverEnv(logger, testContext)
 		opts = map[string]interface{}{}
 
-		fakeInvoker = &dockerdriverfakes.FakeInvoker{}
+		fakeMountUtil = &mountfakes.FakeInterface{}
 		fakeIoutil = &ioutil_fake.FakeIoutil{}
 		fakeOs = &os_fake.FakeOs{}
 
 		config := smbdriver.NewSmbConfig()
 		_ = config.ReadConf("username,password,vers,uid,gid,file_mode,dir_mode,readonly,ro", "", []string{})
 
-		subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, fakeIoutil, config)
+		subject = smbdriver.NewSmbMounter(fakeOs, fakeIoutil, config, fakeMountUtil, "", "", "")
 	})
 
 	Context("#Mount", func() {
 		Context("when mount succeeds", func() {
 			JustBeforeEach(func() {
-				fakeInvoker.InvokeReturns(nil, nil)
+				fakeMountUtil.MountReturns(nil)
 				err = subject.Mount(env, "source", "target", opts)
 			})
 
@@ -65,10 +68,10 @@ var _ = Describe("SmbMounter", func() {
 			})
 
 			It("should use the passed in variables", func() {
-				_, cmd, args := fakeInvoker.InvokeArgsForCall(0)
-				Expect(cmd).To(Equal("mount"))
-				Expect(strings.Join(args, " ")).To(ContainSubstring("source"))
-				Expect(strings.Join(args, " ")).To(ContainSubstring("target"))
+				source, target, fstype, _ := fakeMountUtil.MountArgsForCall(0)
+				Expect(source).To(Equal("source"))
+				Expect(target).To(Equal("target"))
+				Expect(fstype).To(Equal("cifs"))
 			})
 
 			Context("when mounting read only with readonly", func() {
@@ -78,8 +81,8 @@ var _ = Describe("SmbMounter", func() {
 					})
 
 					It("should include the ro flag", func() {
-						_, _, args := fakeInvoker.InvokeArgsForCall(0)
-						Expect(strings.Join(args, " ")).To(ContainSubstring("ro"))
+						_, _, _, options := fakeMountUtil.MountArgsForCall(0)
+						Expect(options).To(ContainElement("ro"))
 					})
 				})
 
@@ -89,16 +92,57 @@ var _ = Describe("SmbMounter", func() {
 					})
 
 					It("should include the ro flag", func() {
-						_, _, args := fakeInvoker.InvokeArgsForCall(0)
-						Expect(strings.Join(args, " ")).To(ContainSubstring("ro"))
+						_, _, _, options := fakeMountUtil.MountArgsForCall(0)
+						Expect(options).To(ContainElement("ro"))
 					})
 				})
 			})
+
+			Context("when credentials_file is requested", func() {
+				var credentialsFile *os.File
+
+				BeforeEach(func() {
+					opts["username"] = "fakeusername"
+					opts["password"] = "fakepassword"
+					opts["credentials_file"] = true
+
+					var err error
+					credentialsFile, err = ioutil.TempFile("", "smb-credentials-test-")
+					Expect(err).NotTo(HaveOccurred())
+					fakeIoutil.TempFileReturns(credentialsFile, nil)
+				})
+
+				AfterEach(func() {
+					os.Remove(credentialsFile.Name())
+				})
+
+				It("should not pass the plaintext username or password to the mount options", func() {
+					_, _, _, options := fakeMountUtil.MountArgsForCall(0)
+					Expect(options).NotTo(ContainElement("username=fakeusername"))
+					Expect(options).NotTo(ContainElement("password=fakepassword"))
+				})
+
+				It("should pass a credentials option pointing at the written file", func() {
+					_, _, _, options := fakeMountUtil.MountArgsForCall(0)
+					Expect(options).To(ContainElement("credentials=" + credentialsFile.Name()))
+				})
+
+				It("should write the credentials to the file", func() {
+					contents, err := ioutil.ReadFile(credentialsFile.Name())
+					Expect(err).NotTo(HaveOccurred())
+					Expect(string(contents)).To(ContainSubstring("username=fakeusername"))
+					Expect(string(contents)).To(ContainSubstring("password=fakepassword"))
+				})
+
+				It("should remove the credentials file once the mount has started", func() {
+					Expect(fakeOs.RemoveArgsForCall(fakeOs.RemoveCallCount() - 1)).To(Equal(credentialsFile.Name()))
+				})
+			})
 		})
 
 		Context("when mount errors", func() {
 			BeforeEach(func() {
-				fakeInvoker.InvokeReturns([]byte("error"), fmt.Errorf("error"))
+				fakeMountUtil.MountReturns(fmt.Errorf("error"))
 
 				err = subject.Mount(env, "source", "target", opts)
 			})
@@ -111,7 +155,21 @@ var _ = Describe("SmbMounter", func() {
 		})
 
 		Context("when mount is cancelled", func() {
-			// TODO: when we pick up the lager.Context
+			It("unmounts in the background once the context is done", func() {
+				ctx, cancel := context.WithCancel(context.TODO())
+				cancelledEnv := driverhttp.NewHttpDriverEnv(logger, ctx)
+
+				fakeMountUtil.MountStub = func(source, target, fstype string, options []string) error {
+					cancel()
+					time.Sleep(10 * time.Millisecond)
+					return nil
+				}
+
+				err = subject.Mount(cancelledEnv, "source", "target", opts)
+				Expect(err).NotTo(HaveOccurred())
+
+				Eventually(fakeMountUtil.UnmountCallCount).Should(BeNumerically(">=", 1))
+			})
 		})
 
 		Context("when error occurs", func() {
@@ -121,9 +179,9 @@ var _ = Describe("SmbMounter", func() {
 				config := smbdriver.NewSmbConfig()
 				_ = config.ReadConf("password,vers,file_mode,dir_mode,readonly", "", []string{"username"})
 
-				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, fakeIoutil, config)
+				subject = smbdriver.NewSmbMounter(fakeOs, fakeIoutil, config, fakeMountUtil, "", "", "")
 
-				fakeInvoker.InvokeReturns(nil, nil)
+				fakeMountUtil.MountReturns(nil)
 			})
 
 			JustBeforeEach(func() {
@@ -158,7 +216,7 @@ var _ = Describe("SmbMounter", func() {
 	Context("#Unmount", func() {
 		Context("when mount succeeds", func() {
 			BeforeEach(func() {
-				fakeInvoker.InvokeReturns(nil, nil)
+				fakeMountUtil.UnmountReturns(nil)
 
 				err = subject.Unmount(env, "target")
 			})
@@ -168,17 +226,15 @@ var _ = Describe("SmbMounter", func() {
 			})
 
 			It("should use the passed in variables", func() {
-				_, cmd, args := fakeInvoker.InvokeArgsForCall(0)
-				Expect(cmd).To(Equal("umount"))
-				Expect(len(args)).To(Equal(2))
-				Expect(args[0]).To(Equal("-l"))
-				Expect(args[1]).To(Equal("target"))
+				target, flags := fakeMountUtil.UnmountArgsForCall(0)
+				Expect(target).To(Equal("target"))
+				Expect(flags).To(Equal(mount.MntDetach))
 			})
 		})
 
 		Context("when unmount fails", func() {
 			BeforeEach(func() {
-				fakeInvoker.InvokeReturns([]byte("error"), fmt.Errorf("error"))
+				fakeMountUtil.UnmountReturns(fmt.Errorf("error"))
 				err = subject.Unmount(env, "target")
 			})
 
@@ -191,6 +247,69 @@ var _ = Describe("SmbMounter", func() {
 		})
 	})
 
+	Context("safepath enforcement against a real volumesRoot", func() {
+		var (
+			volumesRoot string
+			target      string
+		)
+
+		BeforeEach(func() {
+			var err error
+			volumesRoot, err = ioutil.TempDir("", "smb-mounter-volumes")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(os.MkdirAll(filepath.Join(volumesRoot, "nested"), 0700)).To(Succeed())
+
+			config := smbdriver.NewSmbConfig()
+			_ = config.ReadConf("username,password", "", []string{})
+
+			subject = smbdriver.NewSmbMounter(fakeOs, fakeIoutil, config, fakeMountUtil, volumesRoot, "", "")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(volumesRoot)
+		})
+
+		Context("when the target itself is a symlink planted under volumesRoot", func() {
+			BeforeEach(func() {
+				outside, err := ioutil.TempDir("", "smb-mounter-outside")
+				Expect(err).NotTo(HaveOccurred())
+
+				target = filepath.Join(volumesRoot, "nested", "escape")
+				Expect(os.Symlink(outside, target)).To(Succeed())
+			})
+
+			It("refuses to Mount", func() {
+				err := subject.Mount(env, "source", target, map[string]interface{}{"username": "u", "password": "p"})
+				Expect(err).To(HaveOccurred())
+				_, ok := err.(dockerdriver.SafeError)
+				Expect(ok).To(BeTrue())
+				Expect(fakeMountUtil.MountCallCount()).To(BeZero())
+			})
+
+			It("refuses to Unmount", func() {
+				err := subject.Unmount(env, target)
+				Expect(err).To(HaveOccurred())
+				_, ok := err.(dockerdriver.SafeError)
+				Expect(ok).To(BeTrue())
+				Expect(fakeMountUtil.UnmountCallCount()).To(BeZero())
+			})
+		})
+
+		Context("when the target is a legitimate descendant of volumesRoot", func() {
+			BeforeEach(func() {
+				target = filepath.Join(volumesRoot, "nested", "mountpoint")
+			})
+
+			It("allows Mount through to the mount util", func() {
+				fakeMountUtil.MountReturns(nil)
+				err := subject.Mount(env, "source", target, map[string]interface{}{"username": "u", "password": "p"})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(fakeMountUtil.MountCallCount()).To(Equal(1))
+			})
+		})
+	})
+
 	Context("#Check", func() {
 		var (
 			success bool
@@ -198,12 +317,9 @@ var _ = Describe("SmbMounter", func() {
 
 		Context("when check succeeds", func() {
 			BeforeEach(func() {
+				fakeMountUtil.IsLikelyNotMountPointReturns(false, nil)
 				success = subject.Check(env, "target", "source")
 			})
-			It("uses correct context", func() {
-				env, _, _ := fakeInvoker.InvokeArgsForCall(0)
-				Expect(fmt.Sprintf("%#v", env.Context())).To(ContainSubstring("timerCtx"))
-			})
 			It("reports valid mountpoint", func() {
 				Expect(success).To(BeTrue())
 			})
@@ -211,7 +327,7 @@ var _ = Describe("SmbMounter", func() {
 
 		Context("when check fails", func() {
 			BeforeEach(func() {
-				fakeInvoker.InvokeReturns([]byte("error"), fmt.Errorf("error"))
+				fakeMountUtil.IsLikelyNotMountPointReturns(true, fmt.Errorf("error"))
 				success = subject.Check(env, "target", "source")
 			})
 			It("reports invalid mountpoint", func() {
@@ -237,14 +353,11 @@ var _ = Describe("SmbMounter", func() {
 			})
 
 			It("should attempt to unmount the directory", func() {
-				Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
-
-				_, proc, args := fakeInvoker.InvokeArgsForCall(0)
-				Expect(proc).To(Equal("umount"))
-				Expect(len(args)).To(Equal(3))
-				Expect(args[0]).To(Equal("-l"))
-				Expect(args[1]).To(Equal("-f"))
-				Expect(args[2]).To(Equal("/var/vcap/data/some/path/guidy-guid-guid"))
+				Expect(fakeMountUtil.UnmountCallCount()).To(Equal(1))
+
+				target, flags := fakeMountUtil.UnmountArgsForCall(0)
+				Expect(target).To(Equal("/var/vcap/data/some/path/guidy-guid-guid"))
+				Expect(flags).To(Equal(mount.MntDetach | mount.MntForce))
 			})
 
 			It("should remove the mount directory", func() {
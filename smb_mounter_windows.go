@@ -17,22 +17,89 @@ import (
 	"code.cloudfoundry.org/goshims/ioutilshim"
 	"code.cloudfoundry.org/goshims/osshim"
 	"code.cloudfoundry.org/lager"
+	"code.cloudfoundry.org/smbdriver/safepath"
 	"code.cloudfoundry.org/volumedriver"
 )
 
 const ScriptsPath = "C:/var/vcap/jobs/smbdriver-windows/scripts"
 
+// credentialsFileOpt opts a single mount into credentials-file mode even
+// when the Config wasn't built with SetUseCredentialsFile(true).
+const credentialsFileOpt = "credentials_file"
+
 // smbMounter represent volumedriver.Mounter for SMB
 type smbMounter struct {
-	invoker invoker.Invoker
-	osutil  osshim.Os
-	ioutil  ioutilshim.Ioutil
-	config  Config
+	invoker    invoker.Invoker
+	osutil     osshim.Os
+	ioutil     ioutilshim.Ioutil
+	config     Config
+	refTracker *mountRefTracker
+	scratchDir string
 }
 
-// NewSmbMounter create SMB mounter
-func NewSmbMounter(invoker invoker.Invoker, osutil osshim.Os, ioutil ioutilshim.Ioutil, config *Config) volumedriver.Mounter {
-	return &smbMounter{invoker: invoker, osutil: osutil, ioutil: ioutil, config: *config}
+// NewSmbMounter create SMB mounter. stateDir is where the mount refcount
+// table is persisted so it survives a driver restart; pass "" to keep it
+// in memory only (as tests do). scratchDir is where credentials files are
+// written before export_credentials.ps1 DPAPI-encrypts them; it's expected
+// to already be backed by a RAM-backed volume (the caller's responsibility)
+// so the brief plaintext copy never touches disk; pass "" to fall back to
+// the OS default temp directory (as tests do).
+func NewSmbMounter(invoker invoker.Invoker, osutil osshim.Os, ioutil ioutilshim.Ioutil, config *Config, stateDir string, scratchDir string) volumedriver.Mounter {
+	statePath := ""
+	if stateDir != "" {
+		statePath = filepath.Join(stateDir, "mount-refs.json")
+	}
+
+	return &smbMounter{
+		invoker:    invoker,
+		osutil:     osutil,
+		ioutil:     ioutil,
+		config:     *config,
+		refTracker: newMountRefTracker(statePath),
+		scratchDir: scratchDir,
+	}
+}
+
+// Debug returns a snapshot of the mount refcount table, for an HTTP admin
+// surface to report on.
+func (m *smbMounter) Debug() map[string]mountRefEntry {
+	return m.refTracker.Debug()
+}
+
+// writeCredentialsFile writes username/password/domain in plaintext to a
+// scratchDir file, then has mounter.ps1's companion export script read that
+// same file and DPAPI-encrypt it in place with Export-Clixml - the plaintext
+// never appears on any process's command line (where /proc/<pid>/cmdline's
+// Windows equivalent, Get-Process's CommandLine, could read it), only in the
+// file itself, and Export-Clixml's output can only be decrypted by the same
+// user account on the same machine. The caller is responsible for removing
+// the file once the mount has started.
+func (m *smbMounter) writeCredentialsFile(env dockerdriver.Env, username, password, domain string) (string, error) {
+	f, err := m.ioutil.TempFile(m.scratchDir, "smb-credentials-")
+	if err != nil {
+		return "", err
+	}
+	credentialsPath := f.Name()
+
+	contents := fmt.Sprintf("username=%s\npassword=%s\ndomain=%s\n", username, password, domain)
+	if _, err := f.WriteString(contents); err != nil {
+		f.Close()
+		return "", err
+	}
+	f.Close()
+
+	exportOptions := []string{
+		"-file",
+		path.Join(ScriptsPath, "export_credentials.ps1"),
+		"-credentialsFile",
+		credentialsPath,
+	}
+
+	if _, err := m.invoker.Invoke(env, "powershell.exe", exportOptions); err != nil {
+		return "", err
+	}
+
+	return credentialsPath, nil
 }
 
 // Reference: https://www.samba.org/samba/docs/man/manpages-3/mount.cifs.8.html
@@ -48,11 +115,16 @@ func (m *smbMounter) Mount(env dockerdriver.Env, source string, target string, o
 	logger.Info("start")
 	defer logger.Info("end")
 
+	if m.refTracker.Acquire(source, target) {
+		logger.Info("already-mounted", lager.Data{"source": source, "target": target})
+		return nil
+	}
+
 	// TODO--refactor the config object so that we don't have to make a local copy just to keep
 	// TODO--it from leaking information between mounts.
 	tempConfig := m.config.Copy()
 
-	if err := tempConfig.SetEntries(opts, []string{"source"}); err != nil {
+	if err := tempConfig.SetEntries(opts, []string{"source", credentialsFileOpt}); err != nil {
 		logger.Debug("error-parse-entries", lager.Data{
 			"given_source":  source,
 			"given_target":  target,
@@ -62,17 +134,51 @@ func (m *smbMounter) Mount(env dockerdriver.Env, source string, target string, o
 		return err
 	}
 
-	mountOptions := []string{
-		"-file",
-		path.Join(ScriptsPath, "mounter.ps1"),
-		"-username",
-		opts["username"].(string),
-		"-password",
-		opts["password"].(string),
-		"-remotePath",
-		source,
-		"-localPath",
-		target,
+	useCredentialsFile := tempConfig.UseCredentialsFile()
+	if raw, ok := opts[credentialsFileOpt]; ok {
+		if b, ok := raw.(bool); ok {
+			useCredentialsFile = b
+		}
+		delete(opts, credentialsFileOpt)
+	}
+
+	var mountOptions []string
+	if useCredentialsFile {
+		domain, _ := opts["domain"].(string)
+
+		credentialsPath, err := m.writeCredentialsFile(env, opts["username"].(string), opts["password"].(string), domain)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := m.osutil.Remove(credentialsPath); err != nil {
+				logger.Error("credentials-file-cleanup-failed", err, lager.Data{"path": credentialsPath})
+			}
+		}()
+
+		mountOptions = []string{
+			"-file",
+			path.Join(ScriptsPath, "mounter.ps1"),
+			"-credentialsFile",
+			credentialsPath,
+			"-remotePath",
+			source,
+			"-localPath",
+			target,
+		}
+	} else {
+		mountOptions = []string{
+			"-file",
+			path.Join(ScriptsPath, "mounter.ps1"),
+			"-username",
+			opts["username"].(string),
+			"-password",
+			opts["password"].(string),
+			"-remotePath",
+			source,
+			"-localPath",
+			target,
+		}
 	}
 
 	logger.Debug("parse-mount", lager.Data{
@@ -85,7 +191,12 @@ func (m *smbMounter) Mount(env dockerdriver.Env, source string, target string, o
 
 	logger.Debug("mount", lager.Data{"params": strings.Join(mountOptions, ",")})
 	_, err := m.invoker.Invoke(env, "powershell.exe", mountOptions)
-	return err
+	if err != nil {
+		return err
+	}
+
+	m.refTracker.Confirm(source, target)
+	return nil
 }
 
 // Unmount unmount a SMB folder from a local path
@@ -99,6 +210,11 @@ func (m *smbMounter) Unmount(env dockerdriver.Env, target string) error {
 		return err
 	}
 
+	if !m.refTracker.ReleaseTarget(target) {
+		logger.Info("still-referenced", lager.Data{"target": target})
+		return nil
+	}
+
 	unmountOptions := []string{
 		"-file",
 		path.Join(ScriptsPath, "unmounter.ps1"),
@@ -160,10 +276,36 @@ func (m *smbMounter) Purge(env dockerdriver.Env, path string) {
 	}
 
 	for _, fileInfo := range fileInfos {
-		if fileInfo.IsDir() {
-			if err := m.osutil.Remove(filepath.Join(path, fileInfo.Name())); err != nil {
-				logger.Error("purge-cannot-remove-directory", err, lager.Data{"name": fileInfo.Name(), "path": path})
-			}
+		if !fileInfo.IsDir() {
+			continue
+		}
+
+		m.purgeEntry(logger, path, fileInfo.Name())
+	}
+}
+
+// purgeEntry is split out from Purge so the handle returned by
+// safepath.Resolve can be deferred-closed per entry instead of pinned open
+// until the whole directory has been walked.
+func (m *smbMounter) purgeEntry(logger lager.Logger, path, name string) {
+	entry := filepath.Join(path, name)
+
+	entryPath := entry
+	handle, err := safepath.NewResolver(path).Resolve(entry)
+	if err != nil {
+		if err == safepath.ErrSymlink || err == safepath.ErrEscapesAnchor {
+			logger.Error("purge-unsafe-entry", err, lager.Data{"name": name, "path": path})
+			return
 		}
+		logger.Debug("safepath-resolve-skipped", lager.Data{"path": entry, "error": err.Error()})
+	} else {
+		defer handle.Close()
+		entryPath = handle.Path()
+	}
+
+	m.refTracker.ReleaseTarget(entry)
+
+	if err := m.osutil.Remove(entryPath); err != nil {
+		logger.Error("purge-cannot-remove-directory", err, lager.Data{"name": name, "path": path})
 	}
 }
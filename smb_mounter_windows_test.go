@@ -1,24 +1,25 @@
-// // +build windows
+// +build windows
 
 package smbdriver_test
 
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	"strings"
 
+	"code.cloudfoundry.org/dockerdriver"
+	"code.cloudfoundry.org/dockerdriver/driverhttp"
+	"code.cloudfoundry.org/dockerdriver/invoker/invokerfakes"
 	"code.cloudfoundry.org/goshims/ioutilshim/ioutil_fake"
 	"code.cloudfoundry.org/goshims/osshim/os_fake"
 	"code.cloudfoundry.org/lager"
 	"code.cloudfoundry.org/lager/lagertest"
-	"code.cloudfoundry.org/nfsdriver"
 	"code.cloudfoundry.org/smbdriver"
-	"code.cloudfoundry.org/voldriver"
-	"code.cloudfoundry.org/voldriver/driverhttp"
-	"code.cloudfoundry.org/voldriver/voldriverfakes"
+	"code.cloudfoundry.org/volumedriver"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -27,14 +28,14 @@ var _ = Describe("SmbMounter", func() {
 	var (
 		logger      lager.Logger
 		testContext context.Context
-		env         voldriver.Env
+		env         dockerdriver.Env
 		err         error
 
-		fakeInvoker *voldriverfakes.FakeInvoker
+		fakeInvoker *invokerfakes.FakeInvoker
 		fakeIoutil  *ioutil_fake.FakeIoutil
 		fakeOs      *os_fake.FakeOs
 
-		subject nfsdriver.Mounter
+		subject volumedriver.Mounter
 
 		opts map[string]interface{}
 	)
@@ -45,14 +46,14 @@ var _ = Describe("SmbMounter", func() {
 		env = driverhttp.NewHttpDriverEnv(logger, testContext)
 		opts = map[string]interface{}{}
 
-		fakeInvoker = &voldriverfakes.FakeInvoker{}
+		fakeInvoker = &invokerfakes.FakeInvoker{}
 		fakeIoutil = &ioutil_fake.FakeIoutil{}
 		fakeOs = &os_fake.FakeOs{}
 
 		config := smbdriver.NewSmbConfig()
 		_ = config.ReadConf("username,password", "", []string{})
 
-		subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, fakeIoutil, config)
+		subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, fakeIoutil, config, "", "")
 	})
 
 	Context("#Mount", func() {
@@ -72,27 +73,72 @@ var _ = Describe("SmbMounter", func() {
 			})
 
 			It("should call the powershell mounter script with the correct arguments", func() {
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(1))
+
 				_, cmd, args := fakeInvoker.InvokeArgsForCall(0)
 				Expect(cmd).To(Equal("powershell.exe"))
 				Expect(args[0]).To(Equal("-file"))
-				Expect(args[1]).To(Equal("/var/vcap/jobs/smbdriver/scripts/mounter.ps1"))
+				Expect(args[1]).To(Equal("C:/var/vcap/jobs/smbdriver-windows/scripts/mounter.ps1"))
 				Expect(args[2]).To(Equal("-username"))
 				Expect(args[3]).To(Equal("fakeusername"))
 				Expect(args[4]).To(Equal("-password"))
 				Expect(args[5]).To(Equal("fakepassword"))
 				Expect(args[6]).To(Equal("-remotePath"))
 				Expect(args[7]).To(Equal("source"))
+				Expect(args[8]).To(Equal("-localPath"))
+				Expect(args[9]).To(Equal("target"))
 			})
+		})
+
+		Context("when credentials_file is requested", func() {
+			var credentialsFile *os.File
+
+			BeforeEach(func() {
+				opts["credentials_file"] = true
 
-			It("should make a symbolic link", func() {
+				var err error
+				credentialsFile, err = ioutil.TempFile("", "smb-credentials-test-")
 				Expect(err).NotTo(HaveOccurred())
-				_, cmd, args := fakeInvoker.InvokeArgsForCall(1)
-				Expect(cmd).To(Equal("cmd"))
-				Expect(strings.Join(args, " ")).To(ContainSubstring("/c"))
-				Expect(strings.Join(args, " ")).To(ContainSubstring("mklink"))
-				Expect(strings.Join(args, " ")).To(ContainSubstring("/d"))
-				Expect(strings.Join(args, " ")).To(ContainSubstring("target"))
-				Expect(strings.Join(args, " ")).To(ContainSubstring("source"))
+				fakeIoutil.TempFileReturns(credentialsFile, nil)
+
+				fakeInvoker.InvokeReturns(nil, nil)
+				err = subject.Mount(env, "source", "target", opts)
+				Expect(err).NotTo(HaveOccurred())
+			})
+
+			AfterEach(func() {
+				os.Remove(credentialsFile.Name())
+			})
+
+			It("should export the credentials via export_credentials.ps1 before mounting, without the plaintext password on its command line", func() {
+				Expect(fakeInvoker.InvokeCallCount()).To(Equal(2))
+
+				_, cmd, args := fakeInvoker.InvokeArgsForCall(0)
+				Expect(cmd).To(Equal("powershell.exe"))
+				Expect(args[0]).To(Equal("-file"))
+				Expect(args[1]).To(Equal("C:/var/vcap/jobs/smbdriver-windows/scripts/export_credentials.ps1"))
+				Expect(args).To(ContainElement(credentialsFile.Name()))
+				Expect(args).NotTo(ContainElement("fakeusername"))
+				Expect(args).NotTo(ContainElement("fakepassword"))
+			})
+
+			It("should write the plaintext credentials to the credentials file before exporting", func() {
+				contents, err := ioutil.ReadFile(credentialsFile.Name())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(contents)).To(ContainSubstring("username=fakeusername"))
+				Expect(string(contents)).To(ContainSubstring("password=fakepassword"))
+			})
+
+			It("should mount with -credentialsFile instead of plaintext username/password", func() {
+				_, _, args := fakeInvoker.InvokeArgsForCall(1)
+				Expect(args).To(ContainElement("-credentialsFile"))
+				Expect(args).To(ContainElement(credentialsFile.Name()))
+				Expect(args).NotTo(ContainElement("fakeusername"))
+				Expect(args).NotTo(ContainElement("fakepassword"))
+			})
+
+			It("should remove the credentials file once the mount has started", func() {
+				Expect(fakeOs.RemoveArgsForCall(fakeOs.RemoveCallCount() - 1)).To(Equal(credentialsFile.Name()))
 			})
 		})
 
@@ -102,7 +148,7 @@ var _ = Describe("SmbMounter", func() {
 				err = subject.Mount(env, "source", "target", opts)
 			})
 
-			It("should return without error", func() {
+			It("should return with error", func() {
 				Expect(err).To(HaveOccurred())
 			})
 		})
@@ -114,7 +160,7 @@ var _ = Describe("SmbMounter", func() {
 				config := smbdriver.NewSmbConfig()
 				_ = config.ReadConf("password", "", []string{"username"})
 
-				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, fakeIoutil, config)
+				subject = smbdriver.NewSmbMounter(fakeInvoker, fakeOs, fakeIoutil, config, "", "")
 
 				fakeInvoker.InvokeReturns(nil, nil)
 			})
@@ -160,7 +206,7 @@ var _ = Describe("SmbMounter", func() {
 				_, cmd, args := fakeInvoker.InvokeArgsForCall(0)
 				Expect(cmd).To(Equal("powershell.exe"))
 				Expect(args[0]).To(Equal("-file"))
-				Expect(args[1]).To(Equal("/var/vcap/jobs/smbdriver/scripts/unmounter.ps1"))
+				Expect(args[1]).To(Equal("C:/var/vcap/jobs/smbdriver-windows/scripts/unmounter.ps1"))
 				Expect(args[2]).To(Equal("-remotePath"))
 				Expect(args[3]).To(Equal("source"))
 			})
@@ -169,6 +215,7 @@ var _ = Describe("SmbMounter", func() {
 		Context("when unmount fails", func() {
 			BeforeEach(func() {
 				fakeInvoker.InvokeReturns([]byte("error"), fmt.Errorf("error"))
+				fakeOs.ReadlinkReturns("source", nil)
 				err = subject.Unmount(env, "target")
 			})
 
@@ -191,17 +238,9 @@ var _ = Describe("SmbMounter", func() {
 
 			It("should use the passed in variables", func() {
 				_, cmd, args := fakeInvoker.InvokeArgsForCall(0)
-				Expect(cmd).To(Equal("net"))
-				Expect(strings.Join(args, " ")).To(ContainSubstring("use"))
-				Expect(strings.Join(args, " ")).To(ContainSubstring("|"))
-				Expect(strings.Join(args, " ")).To(ContainSubstring("findstr.exe"))
-				Expect(strings.Join(args, " ")).To(ContainSubstring("/L"))
-				Expect(strings.Join(args, " ")).To(ContainSubstring("'source'"))
-			})
-
-			It("uses correct context", func() {
-				env, _, _ := fakeInvoker.InvokeArgsForCall(0)
-				Expect(fmt.Sprintf("%#v", env.Context())).To(ContainSubstring("timerCtx"))
+				Expect(cmd).To(Equal("powershell.exe"))
+				Expect(strings.Join(args, " ")).To(ContainSubstring("check_mount.ps1"))
+				Expect(strings.Join(args, " ")).To(ContainSubstring("source"))
 			})
 
 			It("reports valid mountpoint", func() {
@@ -221,41 +260,37 @@ var _ = Describe("SmbMounter", func() {
 	})
 
 	Context("#Purge", func() {
-		var (
-			rootPath string
-		)
-
-		BeforeEach(func() {
-			rootPath = filepath.Join("var", "vcap", "data", "some", "path")
-		})
-
 		JustBeforeEach(func() {
-			subject.Purge(env, rootPath)
+			subject.Purge(env, "/var/vcap/data/some/path")
 		})
 
 		Context("when stuff is in the directory", func() {
 			var fakeStuff *ioutil_fake.FakeFileInfo
+
 			BeforeEach(func() {
 				fakeStuff = &ioutil_fake.FakeFileInfo{}
 				fakeStuff.NameReturns("guidy-guid-guid")
 				fakeStuff.IsDirReturns(true)
+
 				fakeIoutil.ReadDirReturns([]os.FileInfo{fakeStuff}, nil)
 			})
 
-			It("should remove stuff", func() {
-				Expect(fakeOs.RemoveAllCallCount()).NotTo(BeZero())
-				path := fakeOs.RemoveAllArgsForCall(0)
-				Expect(path).To(Equal(filepath.Join(rootPath, "guidy-guid-guid")))
+			It("should remove the mount directory", func() {
+				Expect(fakeOs.RemoveCallCount()).To(Equal(1))
+
+				path := fakeOs.RemoveArgsForCall(0)
+				Expect(path).To(Equal(filepath.Join("/var/vcap/data/some/path", "guidy-guid-guid")))
 			})
 
 			Context("when the stuff is not a directory", func() {
 				BeforeEach(func() {
 					fakeStuff.IsDirReturns(false)
 				})
+
 				It("should not remove the stuff", func() {
-					Expect(fakeOs.RemoveAllCallCount()).To(BeZero())
+					Expect(fakeOs.RemoveCallCount()).To(BeZero())
 				})
 			})
 		})
 	})
-})
\ No newline at end of file
+})
@@ -0,0 +1,134 @@
+package smbdriver
+
+import (
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/dockerdriver"
+)
+
+// Config holds the set of options a mount request is allowed, disallowed, and
+// required to specify, plus any default values to apply when an option is
+// omitted.
+type Config struct {
+	allowed            map[string]struct{}
+	mandatory          map[string]struct{}
+	defaults           map[string]interface{}
+	useCredentialsFile bool
+}
+
+// NewSmbConfig creates an empty Config. Callers should follow up with
+// ReadConf to populate the allowed/mandatory option sets before use.
+func NewSmbConfig() *Config {
+	return &Config{
+		allowed:   map[string]struct{}{},
+		mandatory: map[string]struct{}{},
+		defaults:  map[string]interface{}{},
+	}
+}
+
+// SetUseCredentialsFile controls whether the mounter writes the SMB
+// username/password to a credentials file instead of passing them on the
+// mount/powershell invocation's argv, where any local user could otherwise
+// read them via /proc/<pid>/cmdline or Get-Process. Callers can also opt a
+// single mount into this behavior with the "credentials_file" option.
+func (c *Config) SetUseCredentialsFile(use bool) {
+	c.useCredentialsFile = use
+}
+
+// UseCredentialsFile reports whether this Config defaults to credentials-file
+// mode.
+func (c *Config) UseCredentialsFile() bool {
+	return c.useCredentialsFile
+}
+
+// ReadConf parses a comma-separated list of allowed option names, a
+// comma-separated list of "key=value" defaults, and a list of mandatory
+// option names.
+func (c *Config) ReadConf(allowed string, defaultOpts string, mandatory []string) error {
+	for _, opt := range strings.Split(allowed, ",") {
+		opt = strings.TrimSpace(opt)
+		if opt != "" {
+			c.allowed[opt] = struct{}{}
+		}
+	}
+
+	for _, mopt := range mandatory {
+		mopt = strings.TrimSpace(mopt)
+		if mopt == "" {
+			continue
+		}
+		c.mandatory[mopt] = struct{}{}
+		c.allowed[mopt] = struct{}{}
+	}
+
+	if defaultOpts != "" {
+		for _, pair := range strings.Split(defaultOpts, ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return dockerdriver.SafeError{SafeDescription: fmt.Sprintf("Invalid default option %q", pair)}
+			}
+			c.defaults[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	return nil
+}
+
+// Copy returns a deep-enough copy of the Config so a single mount's option
+// parsing can't leak into another mount's view of the config.
+func (c *Config) Copy() *Config {
+	cp := NewSmbConfig()
+	for k := range c.allowed {
+		cp.allowed[k] = struct{}{}
+	}
+	for k := range c.mandatory {
+		cp.mandatory[k] = struct{}{}
+	}
+	for k, v := range c.defaults {
+		cp.defaults[k] = v
+	}
+	cp.useCredentialsFile = c.useCredentialsFile
+	return cp
+}
+
+// SetEntries validates opts against the allowed/mandatory option sets. Keys
+// listed in skip are always permitted (e.g. "source", which is supplied
+// out-of-band rather than via opts).
+func (c *Config) SetEntries(opts map[string]interface{}, skip []string) error {
+	skipped := map[string]struct{}{}
+	for _, s := range skip {
+		skipped[s] = struct{}{}
+	}
+
+	var notAllowed []string
+	for k := range opts {
+		if _, ok := skipped[k]; ok {
+			continue
+		}
+		if _, ok := c.allowed[k]; !ok {
+			notAllowed = append(notAllowed, k)
+		}
+	}
+	if len(notAllowed) > 0 {
+		return dockerdriver.SafeError{SafeDescription: fmt.Sprintf("Not allowed options: %s", strings.Join(notAllowed, ", "))}
+	}
+
+	var missing []string
+	for m := range c.mandatory {
+		if _, ok := opts[m]; !ok {
+			missing = append(missing, m)
+		}
+	}
+	if len(missing) > 0 {
+		return dockerdriver.SafeError{SafeDescription: fmt.Sprintf("Missing mandatory options: %s", strings.Join(missing, ", "))}
+	}
+
+	for k, v := range c.defaults {
+		if _, ok := opts[k]; !ok {
+			opts[k] = v
+		}
+	}
+
+	return nil
+}